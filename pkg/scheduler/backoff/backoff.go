@@ -0,0 +1,155 @@
+// Package backoff tracks per-pod scheduling backoff so that a pod which
+// repeatedly fails to run doesn't get retried in a tight loop.
+package backoff
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cedbossneo/kubernetes-mesos/pkg/scheduler/config"
+)
+
+type backoffEntry struct {
+	backoff      time.Duration
+	lastUpdate   time.Time
+	nextEligible time.Time
+	breakChan    chan struct{}
+}
+
+// PodBackoff tracks, per pod key, how long to wait before that pod is
+// eligible to be scheduled again after a failure. Each failure doubles the
+// wait (capped at max); a waiter can be woken early via NotifyOffer if a
+// matching offer shows up before the backoff expires.
+type PodBackoff struct {
+	rw      sync.Mutex
+	initial time.Duration
+	max     time.Duration
+	entries map[string]*backoffEntry
+}
+
+// New creates a PodBackoff that starts new entries at initial and never
+// grows a single entry's wait past max.
+func New(initial, max time.Duration) *PodBackoff {
+	return &PodBackoff{
+		initial: initial,
+		max:     max,
+		entries: make(map[string]*backoffEntry),
+	}
+}
+
+// NewFromConfig creates a PodBackoff using cfg's InitialPodBackoff and
+// MaxPodBackoff knobs.
+func NewFromConfig(cfg *config.Config) *PodBackoff {
+	return New(cfg.InitialPodBackoff.Duration, cfg.MaxPodBackoff.Duration)
+}
+
+// entryLocked returns podKey's entry, creating it at the initial backoff if
+// it doesn't exist yet. assumes the caller holds b.rw.
+func (b *PodBackoff) entryLocked(podKey string) *backoffEntry {
+	entry, ok := b.entries[podKey]
+	if !ok {
+		entry = &backoffEntry{backoff: b.initial}
+		b.entries[podKey] = entry
+	}
+	return entry
+}
+
+// Bump records a scheduling failure for podKey, doubling its backoff
+// duration (capped at max) and returns the new duration the pod must wait
+// before it's eligible again.
+func (b *PodBackoff) Bump(podKey string) time.Duration {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	entry, ok := b.entries[podKey]
+	if !ok {
+		entry = &backoffEntry{backoff: b.initial}
+		b.entries[podKey] = entry
+	} else {
+		entry.backoff *= 2
+		if entry.backoff > b.max {
+			entry.backoff = b.max
+		}
+	}
+	entry.lastUpdate = time.Now()
+	entry.nextEligible = entry.lastUpdate.Add(entry.backoff)
+	return entry.backoff
+}
+
+// Clear drops all backoff state for podKey, e.g. once it's been
+// successfully scheduled.
+func (b *PodBackoff) Clear(podKey string) {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+	delete(b.entries, podKey)
+}
+
+// breakChanLocked returns entry's break channel, creating it if needed.
+// assumes the caller holds b.rw.
+func breakChanLocked(entry *backoffEntry) chan struct{} {
+	if entry.breakChan == nil {
+		entry.breakChan = make(chan struct{})
+	}
+	return entry.breakChan
+}
+
+// BreakChan returns a channel that's closed the next time NotifyOffer is
+// called for podKey, so that a goroutine blocked in Wait can return early
+// when a matching offer arrives before the backoff has elapsed.
+func (b *PodBackoff) BreakChan(podKey string) <-chan struct{} {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+	return breakChanLocked(b.entryLocked(podKey))
+}
+
+// NotifyOffer wakes any goroutine waiting on BreakChan(podKey), e.g.
+// because a matching offer just arrived for that pod.
+func (b *PodBackoff) NotifyOffer(podKey string) {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+	entry, ok := b.entries[podKey]
+	if !ok || entry.breakChan == nil {
+		return
+	}
+	close(entry.breakChan)
+	entry.breakChan = nil
+}
+
+// Wait blocks until podKey's backoff has elapsed or NotifyOffer(podKey) is
+// called, whichever happens first. It returns immediately if podKey has no
+// recorded failures.
+func (b *PodBackoff) Wait(podKey string) {
+	b.rw.Lock()
+	entry, ok := b.entries[podKey]
+	if !ok {
+		b.rw.Unlock()
+		return
+	}
+	wait := entry.nextEligible.Sub(time.Now())
+	breakChan := breakChanLocked(entry)
+	b.rw.Unlock()
+
+	if wait <= 0 {
+		return
+	}
+	select {
+	case <-time.After(wait):
+	case <-breakChan:
+	}
+}
+
+// GC removes entries that have been idle for more than twice the maximum
+// backoff duration, so bookkeeping doesn't grow unbounded for pods that
+// eventually schedule successfully and are never Clear()'d explicitly.
+func (b *PodBackoff) GC() {
+	b.rw.Lock()
+	defer b.rw.Unlock()
+
+	expiry := 2 * b.max
+	now := time.Now()
+	for podKey, entry := range b.entries {
+		if now.Sub(entry.lastUpdate) > expiry {
+			delete(b.entries, podKey)
+		}
+	}
+}
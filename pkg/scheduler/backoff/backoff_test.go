@@ -0,0 +1,85 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBumpDoublesAndCaps(t *testing.T) {
+	b := New(1*time.Second, 4*time.Second)
+
+	if d := b.Bump("pod1"); d != 1*time.Second {
+		t.Fatalf("first Bump = %v, want initial %v", d, 1*time.Second)
+	}
+	if d := b.Bump("pod1"); d != 2*time.Second {
+		t.Fatalf("second Bump = %v, want %v", d, 2*time.Second)
+	}
+	if d := b.Bump("pod1"); d != 4*time.Second {
+		t.Fatalf("third Bump = %v, want %v", d, 4*time.Second)
+	}
+	if d := b.Bump("pod1"); d != 4*time.Second {
+		t.Fatalf("Bump beyond max = %v, want capped at %v", d, 4*time.Second)
+	}
+}
+
+func TestClearResetsBackoff(t *testing.T) {
+	b := New(1*time.Second, 4*time.Second)
+	b.Bump("pod1")
+	b.Bump("pod1")
+	b.Clear("pod1")
+
+	if d := b.Bump("pod1"); d != 1*time.Second {
+		t.Fatalf("Bump after Clear = %v, want initial %v", d, 1*time.Second)
+	}
+}
+
+func TestNotifyOfferWakesWaiter(t *testing.T) {
+	b := New(time.Hour, time.Hour)
+	b.Bump("pod1")
+
+	done := make(chan struct{})
+	go func() {
+		b.Wait("pod1")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Wait returned before NotifyOffer despite an hour-long backoff")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.NotifyOffer("pod1")
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after NotifyOffer")
+	}
+}
+
+func TestWaitReturnsImmediatelyForUnknownPod(t *testing.T) {
+	b := New(time.Hour, time.Hour)
+	done := make(chan struct{})
+	go func() {
+		b.Wait("never-bumped")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked for a pod with no recorded failures")
+	}
+}
+
+func TestGCRemovesIdleEntries(t *testing.T) {
+	b := New(time.Millisecond, 2*time.Millisecond)
+	b.Bump("stale")
+
+	time.Sleep(10 * time.Millisecond) // well past 2*max
+	b.GC()
+
+	if d := b.Bump("stale"); d != time.Millisecond {
+		t.Fatalf("Bump after GC = %v, want initial %v (entry should have been collected)", d, time.Millisecond)
+	}
+}
@@ -19,6 +19,7 @@ const (
 	DefaultInitialPodBackoff                  = 1 * time.Second
 	DefaultMaxPodBackoff                      = 60 * time.Second
 	DefaultHttpHandlerTimeout                 = 10 * time.Second
+	DefaultMaxReconciliationAttempts          = 3 // failed reconciliation attempts for a task before we give up and kill it
 )
 
 // Example scheduler configuration file:
@@ -44,6 +45,7 @@ type Config struct {
 	InitialPodBackoff                  WrappedDuration `gcfg:"initial-pod-backoff"`
 	MaxPodBackoff                      WrappedDuration `gcfg:"max-pod-backoff"`
 	HttpHandlerTimeout                 WrappedDuration `gcfg:"http-handler-timeout"`
+	MaxReconciliationAttempts          int             `gcfg:"max-reconciliation-attempts"`
 }
 
 type WrappedDuration struct {
@@ -70,6 +72,7 @@ func (c *Config) SetDefaults() {
 	c.InitialPodBackoff = WrappedDuration{DefaultInitialPodBackoff}
 	c.MaxPodBackoff = WrappedDuration{DefaultMaxPodBackoff}
 	c.HttpHandlerTimeout = WrappedDuration{DefaultHttpHandlerTimeout}
+	c.MaxReconciliationAttempts = DefaultMaxReconciliationAttempts
 }
 
 func CreateDefaultConfig() *Config {
@@ -85,5 +88,6 @@ func (c *Config) Read(configReader io.Reader) error {
 			return err
 		}
 	}
+	*c = wrapper.Scheduler
 	return nil
 }
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+[scheduler]
+offer-ttl = 17s
+`
+
+func TestConfigReadAppliesValues(t *testing.T) {
+	c := CreateDefaultConfig()
+	if err := c.Read(strings.NewReader(testConfig)); err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if c.OfferTTL.Duration != 17*time.Second {
+		t.Errorf("expected OfferTTL to be updated to 17s, got %v", c.OfferTTL.Duration)
+	}
+}
+
+func TestManagerReloadAppliesValues(t *testing.T) {
+	m := NewManager(CreateDefaultConfig())
+	if err := m.Reload(strings.NewReader(testConfig)); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+	if got := m.Current().OfferTTL.Duration; got != 17*time.Second {
+		t.Errorf("expected Manager.Current().OfferTTL to be 17s after Reload, got %v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// Observer is notified with the config in effect before and after a
+// successful Reload, so subscribers can react to the fields they care
+// about without polling Manager.Current.
+type Observer func(old, new *Config)
+
+// Manager owns the scheduler's live Config and allows it to be replaced
+// atomically at runtime, e.g. via SIGHUP or the /config HTTP endpoint,
+// without restarting the framework and losing in-memory task state.
+type Manager struct {
+	rw        sync.RWMutex
+	cfg       *Config
+	observers []Observer
+}
+
+// NewManager creates a Manager around cfg. If cfg is nil, a
+// default-initialized Config is used.
+func NewManager(cfg *Config) *Manager {
+	if cfg == nil {
+		cfg = CreateDefaultConfig()
+	}
+	return &Manager{cfg: cfg}
+}
+
+// Current returns a copy of the config currently in effect.
+func (m *Manager) Current() *Config {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	cfg := *m.cfg
+	return &cfg
+}
+
+// Observe registers a callback to be invoked after every successful
+// Reload with the old and new configs.
+func (m *Manager) Observe(o Observer) {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+	m.observers = append(m.observers, o)
+}
+
+// Reload parses a config from r, validates it, and atomically swaps it in
+// if valid. Observers are notified after the swap. The config in effect is
+// left unchanged if Reload returns an error.
+func (m *Manager) Reload(r io.Reader) error {
+	next := CreateDefaultConfig()
+	if err := next.Read(r); err != nil {
+		return fmt.Errorf("failed to parse config: %v", err)
+	}
+	if err := validate(next); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	m.rw.Lock()
+	old := m.cfg
+	m.cfg = next
+	observers := make([]Observer, len(m.observers))
+	copy(observers, m.observers)
+	m.rw.Unlock()
+
+	for _, observe := range observers {
+		observe(old, next)
+	}
+	return nil
+}
+
+// validate rejects configs that would leave the scheduler in a broken
+// state, e.g. a backoff ceiling below its own floor.
+func validate(c *Config) error {
+	if c.MaxPodBackoff.Duration < c.InitialPodBackoff.Duration {
+		return fmt.Errorf("max-pod-backoff (%v) must be >= initial-pod-backoff (%v)",
+			c.MaxPodBackoff.Duration, c.InitialPodBackoff.Duration)
+	}
+	if c.UpdatesBacklog <= 0 {
+		return fmt.Errorf("updates-backlog must be > 0, got %d", c.UpdatesBacklog)
+	}
+	return nil
+}
+
+// InstallSIGHUPHandler starts a goroutine that reloads the config from
+// path every time the process receives SIGHUP, the conventional signal for
+// "re-read your config file" on unix daemons.
+func (m *Manager) InstallSIGHUPHandler(path string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			log.Infof("SIGHUP received, reloading scheduler config from %v", path)
+			f, err := os.Open(path)
+			if err != nil {
+				log.Errorf("failed to open %v for config reload: %v", path, err)
+				continue
+			}
+			err = m.Reload(f)
+			f.Close()
+			if err != nil {
+				log.Errorf("config reload failed, keeping previous config: %v", err)
+			}
+		}
+	}()
+}
+
+// ServeHTTP implements a PUT /config endpoint that reloads the scheduler
+// config from the request body, bounded by the current HttpHandlerTimeout.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "PUT" {
+		http.Error(w, "only PUT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- m.Reload(req.Body) }()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case <-time.After(m.Current().HttpHandlerTimeout.Duration):
+		http.Error(w, "timed out reloading config", http.StatusGatewayTimeout)
+	}
+}
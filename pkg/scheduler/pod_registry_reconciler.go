@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	log "github.com/golang/glog"
+)
+
+const (
+	// TaskIdKey is the pod annotation under which we stash the Mesos task ID
+	// we launched the pod as, so that we can recover it after a scheduler
+	// failover without any other durable state.
+	TaskIdKey = "k8s.mesosphere.io/taskId"
+	// SlaveIdKey is the pod annotation holding the slave ID the task was
+	// launched on.
+	SlaveIdKey = "k8s.mesosphere.io/slaveId"
+)
+
+// podRegistryReconciler helps recover after a scheduler failover by listing
+// pods from the k8s API server and explicitly reconciling the task IDs
+// recorded in their annotations. It does not add the recovered tasks to the
+// task registry, and the slave ID annotation is only logged; it is not sent
+// to the Mesos master.
+type podRegistryReconciler struct {
+	client     *client.Client
+	reconciler *Reconciler
+}
+
+// newPodRegistryReconciler creates a podRegistryReconciler that recovers
+// task state via c and feeds explicit reconciliation requests to r.
+func newPodRegistryReconciler(c *client.Client, r *Reconciler) *podRegistryReconciler {
+	return &podRegistryReconciler{
+		client:     c,
+		reconciler: r,
+	}
+}
+
+// Reconcile lists all pods across namespaces and asks the Mesos master
+// about every task referenced by a pod's annotations.
+func (p *podRegistryReconciler) Reconcile() error {
+	pods, err := p.client.Pods(api.NamespaceAll).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	tasks := make([]*PodTask, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		taskID, ok := pod.Annotations[TaskIdKey]
+		if !ok {
+			continue
+		}
+		slaveID := pod.Annotations[SlaveIdKey]
+		log.V(1).Infof("recovering task %v (slave %v) for pod %v/%v from failover", taskID, slaveID, pod.Namespace, pod.Name)
+
+		podKey, err := makePodKey(api.WithNamespace(api.NewContext(), pod.Namespace), pod.Name)
+		if err != nil {
+			log.Errorf("failed to build pod key for %v/%v, skipping recovery of task %v: %v", pod.Namespace, pod.Name, taskID, err)
+			continue
+		}
+		tasks = append(tasks, &PodTask{ID: taskID, podKey: podKey})
+	}
+
+	if len(tasks) == 0 {
+		return nil
+	}
+	p.reconciler.RequestExplicit(tasks)
+	return nil
+}
@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	bindings "github.com/mesos/mesos-go/scheduler"
+
+	"github.com/cedbossneo/kubernetes-mesos/pkg/scheduler/config"
+)
+
+// Reconciler keeps the scheduler's view of task state in sync with the
+// Mesos master's. It runs implicit reconciliation once, shortly after
+// framework registration, and explicit reconciliation on an exponential
+// backoff thereafter. Tasks that repeatedly fail to reconcile are assumed
+// to be unknown to the master and are killed and dropped from the
+// registry.
+type Reconciler struct {
+	driver   bindings.SchedulerDriver
+	registry TaskRegistry
+	cfg      *config.Config
+
+	lock     sync.Mutex
+	cancel   chan struct{} // closed to abort an in-flight explicit cycle
+	attempts map[string]int
+}
+
+// NewReconciler creates a Reconciler bound to the given driver and task
+// registry. cfg supplies the timing and backoff knobs.
+func NewReconciler(driver bindings.SchedulerDriver, registry TaskRegistry, cfg *config.Config) *Reconciler {
+	return &Reconciler{
+		driver:   driver,
+		registry: registry,
+		cfg:      cfg,
+		attempts: make(map[string]int),
+	}
+}
+
+// Run starts the implicit-once / explicit-backoff reconciliation loops.
+// It returns immediately; the loops stop when done is closed.
+func (r *Reconciler) Run(done <-chan struct{}) {
+	go r.runImplicitOnce(done)
+	go r.runExplicitLoop(done)
+}
+
+func (r *Reconciler) runImplicitOnce(done <-chan struct{}) {
+	select {
+	case <-time.After(r.cfg.InitialImplicitReconciliationDelay.Duration):
+	case <-done:
+		return
+	}
+	log.Infoln("performing initial implicit task reconciliation")
+	if _, err := r.driver.ReconcileTasks(nil); err != nil {
+		log.Errorf("implicit reconciliation failed: %v", err)
+	}
+}
+
+// initialExplicitReconciliationBackoff is the starting interval between
+// explicit reconciliation cycles, doubling up to
+// ExplicitReconciliationMaxBackoff. This is reconciliation cadence, not pod
+// scheduling backoff, so it intentionally doesn't borrow InitialPodBackoff.
+const initialExplicitReconciliationBackoff = 1 * time.Second
+
+func (r *Reconciler) runExplicitLoop(done <-chan struct{}) {
+	backoff := initialExplicitReconciliationBackoff
+	maxBackoff := r.cfg.ExplicitReconciliationMaxBackoff.Duration
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-done:
+			return
+		}
+		r.reconcileExplicit(r.registry.nonTerminalTasks())
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// RequestExplicit triggers an out-of-band explicit reconciliation cycle for
+// the given tasks, aborting any cycle already in flight. It's used by the
+// podRegistryReconciler to reconcile the task IDs recorded in pod
+// annotations after failover.
+func (r *Reconciler) RequestExplicit(tasks []*PodTask) {
+	r.abortInFlight()
+	r.reconcileExplicit(tasks)
+}
+
+func (r *Reconciler) abortInFlight() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.cancel != nil {
+		close(r.cancel)
+		r.cancel = nil
+	}
+}
+
+func (r *Reconciler) reconcileExplicit(tasks []*PodTask) {
+	if len(tasks) == 0 {
+		return
+	}
+
+	r.lock.Lock()
+	cancel := make(chan struct{})
+	r.cancel = cancel
+	r.lock.Unlock()
+
+	stubs := make([]*mesos.TaskStatus, 0, len(tasks))
+	for _, t := range tasks {
+		stubs = append(stubs, reconciliationStub(t.ID))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.driver.ReconcileTasks(stubs)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Errorf("explicit reconciliation failed: %v, counting as a failed attempt for %d tasks", err, len(tasks))
+			r.recordFailedAttempts(tasks)
+			return
+		}
+		r.resetAttempts(tasks)
+	case <-cancel:
+		log.V(1).Infoln("explicit reconciliation cycle aborted in favor of a newer one")
+	case <-time.After(r.cfg.ExplicitReconciliationAbortTimeout.Duration):
+		log.Warningf("explicit reconciliation timed out after %v, counting as a failed attempt for %d tasks",
+			r.cfg.ExplicitReconciliationAbortTimeout.Duration, len(tasks))
+		r.recordFailedAttempts(tasks)
+	}
+}
+
+// reconciliationStub builds the minimal TaskStatus Mesos requires to ask
+// "what do you know about this task?" during explicit reconciliation.
+func reconciliationStub(taskID string) *mesos.TaskStatus {
+	return &mesos.TaskStatus{
+		TaskId: &mesos.TaskID{Value: &taskID},
+		State:  mesos.TaskState_TASK_STAGING.Enum(),
+	}
+}
+
+func (r *Reconciler) resetAttempts(tasks []*PodTask) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, t := range tasks {
+		delete(r.attempts, t.ID)
+	}
+}
+
+func (r *Reconciler) recordFailedAttempts(tasks []*PodTask) {
+	maxAttempts := r.cfg.MaxReconciliationAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = config.DefaultMaxReconciliationAttempts
+	}
+
+	r.lock.Lock()
+	toKill := make([]*PodTask, 0)
+	for _, t := range tasks {
+		r.attempts[t.ID]++
+		if r.attempts[t.ID] >= maxAttempts {
+			toKill = append(toKill, t)
+			delete(r.attempts, t.ID)
+		}
+	}
+	r.lock.Unlock()
+
+	for _, t := range toKill {
+		log.Warningf("giving up on task %v after %d failed reconciliation attempts, killing and dropping it", t.ID, maxAttempts)
+		if _, err := r.driver.KillTask(&mesos.TaskID{Value: &t.ID}); err != nil {
+			log.Errorf("failed to kill unreconcilable task %v: %v", t.ID, err)
+		}
+		r.registry.unregister(t)
+	}
+}
@@ -8,9 +8,12 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/record"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/registry/etcd"
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
+
+	"github.com/cedbossneo/kubernetes-mesos/pkg/scheduler/backoff"
 )
 
 /**
@@ -38,23 +41,77 @@ type TaskRegistry interface {
 	taskForPod(podID string) (taskID string, ok bool)
 	updateStatus(status *mesos.TaskStatus) (*PodTask, StateType)
 	list(filter *StateType) []string
+
+	// nonTerminalTasks returns every task the registry still considers live
+	// (StatePending or StateRunning). The reconciler uses this to build the
+	// explicit reconciliation request sent to the Mesos master.
+	nonTerminalTasks() []*PodTask
+
+	// Recover rehydrates the registry from its backing Store, as done on
+	// scheduler startup/failover.
+	Recover() error
+
+	// shouldRetry reports whether the pod identified by podKey is still
+	// eligible to be requeued for scheduling.
+	shouldRetry(podKey string) bool
+
+	SetEventRecorder(recorder record.EventRecorder)
+	SetRetryPolicy(policy RetryPolicy)
+	SetBackoff(b *backoff.PodBackoff)
 }
 
 type inMemoryTaskRegistry struct {
-	rw            sync.RWMutex
-	taskRegistry  map[string]*PodTask
-	tasksFinished *ring.Ring
-	podToTask     map[string]string
+	rw                sync.RWMutex
+	taskRegistry      map[string]*PodTask
+	tasksFinished     *ring.Ring
+	podToTask         map[string]string
+	store             Store
+	recorder          record.EventRecorder
+	retryPolicy       RetryPolicy
+	permanentFailures map[string]bool
+	backoff           *backoff.PodBackoff
 }
 
+// NewInMemoryTaskRegistry creates a TaskRegistry backed only by an
+// in-memory Store -- task state is lost on scheduler restart.
 func NewInMemoryTaskRegistry() TaskRegistry {
+	return NewTaskRegistry(NewInMemoryStore())
+}
+
+// NewTaskRegistry creates a TaskRegistry that persists every task to store,
+// so that a scheduler restart/failover can rehydrate its view of the world
+// via Recover instead of losing the pod<->task mapping.
+func NewTaskRegistry(store Store) TaskRegistry {
 	return &inMemoryTaskRegistry{
-		taskRegistry:  make(map[string]*PodTask),
-		tasksFinished: ring.New(defaultFinishedTasksSize),
-		podToTask:     make(map[string]string),
+		taskRegistry:      make(map[string]*PodTask),
+		tasksFinished:     ring.New(defaultFinishedTasksSize),
+		podToTask:         make(map[string]string),
+		store:             store,
+		permanentFailures: make(map[string]bool),
 	}
 }
 
+// Recover rehydrates the registry from its backing store, as done on
+// scheduler startup/failover. Recovered tasks are marked StatePending so
+// that the reconciler (via nonTerminalTasks) picks them up and confirms
+// their true state with the Mesos master.
+func (k *inMemoryTaskRegistry) Recover() error {
+	tasks, err := k.store.List()
+	if err != nil {
+		return err
+	}
+
+	k.rw.Lock()
+	defer k.rw.Unlock()
+	for _, task := range tasks {
+		task.State = StatePending
+		k.taskRegistry[task.ID] = task
+		k.podToTask[task.podKey] = task.ID
+	}
+	log.Infof("recovered %d task(s) from store, pending reconciliation", len(tasks))
+	return nil
+}
+
 func (k *inMemoryTaskRegistry) list(filter *StateType) (taskids []string) {
 	k.rw.RLock()
 	defer k.rw.RUnlock()
@@ -81,6 +138,9 @@ func (k *inMemoryTaskRegistry) register(task *PodTask, err error) (*PodTask, err
 		defer k.rw.Unlock()
 		k.podToTask[task.podKey] = task.ID
 		k.taskRegistry[task.ID] = task
+		if serr := k.store.Save(task); serr != nil {
+			log.Errorf("failed to persist task %v: %v", task.ID, serr)
+		}
 	}
 	return task, err
 }
@@ -90,6 +150,12 @@ func (k *inMemoryTaskRegistry) unregister(task *PodTask) {
 	defer k.rw.Unlock()
 	delete(k.podToTask, task.podKey)
 	delete(k.taskRegistry, task.ID)
+	if err := k.store.Delete(task.ID); err != nil {
+		log.Errorf("failed to delete persisted task %v: %v", task.ID, err)
+	}
+	if k.backoff != nil {
+		k.backoff.Bump(task.podKey)
+	}
 }
 
 func (k *inMemoryTaskRegistry) get(taskId string) (*PodTask, StateType) {
@@ -106,6 +172,58 @@ func (k *inMemoryTaskRegistry) _get(taskId string) (*PodTask, StateType) {
 	return nil, StateUnknown
 }
 
+func (k *inMemoryTaskRegistry) nonTerminalTasks() (tasks []*PodTask) {
+	k.rw.RLock()
+	defer k.rw.RUnlock()
+	for _, task := range k.taskRegistry {
+		if task.State == StatePending || task.State == StateRunning {
+			tasks = append(tasks, task)
+		}
+	}
+	return
+}
+
+// reconciliationReportsLoss reports whether status's source/reason pair is
+// one that can signal a lost task: a master reply to reconciliation
+// (REASON_RECONCILIATION), or a slave reporting that the task's executor
+// terminated or unregistered. The pair alone is not proof of loss, since
+// Mesos also echoes REASON_RECONCILIATION back for perfectly healthy tasks;
+// masterLostTask additionally requires a terminal TaskState.
+func reconciliationReportsLoss(status *mesos.TaskStatus) bool {
+	switch {
+	case status.GetSource() == mesos.TaskStatus_SOURCE_MASTER && status.GetReason() == mesos.TaskStatus_REASON_RECONCILIATION:
+		return true
+	case status.GetSource() == mesos.TaskStatus_SOURCE_SLAVE && status.GetReason() == mesos.TaskStatus_REASON_EXECUTOR_TERMINATED:
+		return true
+	case status.GetSource() == mesos.TaskStatus_SOURCE_SLAVE && status.GetReason() == mesos.TaskStatus_REASON_EXECUTOR_UNREGISTERED:
+		return true
+	}
+	return false
+}
+
+// masterLostTask reports whether the given status indicates that the Mesos
+// master (or the slave's executor) no longer has any record of a task that
+// we still believe to be live. A REASON_RECONCILIATION update is sent for
+// every task the master still knows about, healthy or not -- the reason
+// alone only means "this was sent in response to a reconcile call", so we
+// only treat it as a loss when the reported TaskState is itself terminal.
+// Such updates arrive in response to explicit or implicit reconciliation
+// and must be treated as terminal so that the pod gets re-scheduled
+// instead of waiting forever for a status that will never come.
+func masterLostTask(state StateType, status *mesos.TaskStatus) bool {
+	if state != StatePending && state != StateRunning {
+		return false
+	}
+	if !reconciliationReportsLoss(status) {
+		return false
+	}
+	switch status.GetState() {
+	case mesos.TaskState_TASK_LOST, mesos.TaskState_TASK_KILLED, mesos.TaskState_TASK_FAILED, mesos.TaskState_TASK_ERROR:
+		return true
+	}
+	return false
+}
+
 func (k *inMemoryTaskRegistry) updateStatus(status *mesos.TaskStatus) (*PodTask, StateType) {
 	taskId := status.GetTaskId().GetValue()
 
@@ -113,6 +231,13 @@ func (k *inMemoryTaskRegistry) updateStatus(status *mesos.TaskStatus) (*PodTask,
 	defer k.rw.Unlock()
 	task, state := k._get(taskId)
 
+	if masterLostTask(state, status) {
+		log.Warningf("master reports no knowledge of task %v (source=%v reason=%v), marking terminal: %+v",
+			taskId, status.GetSource(), status.GetReason(), status)
+		k.deleteTask(task, status)
+		return task, state
+	}
+
 	switch status.GetState() {
 	case mesos.TaskState_TASK_STAGING:
 		k.handleTaskStaging(task, state, status)
@@ -160,6 +285,9 @@ func (k *inMemoryTaskRegistry) handleTaskRunning(task *PodTask, state StateType,
 		log.Infof("Received running status for pending task: %+v", status)
 		fillRunningPodInfo(task, status)
 		task.State = StateRunning
+		if k.backoff != nil {
+			k.backoff.Clear(task.podKey)
+		}
 	case StateRunning:
 		task.UpdatedTime = time.Now()
 		log.V(2).Info("Ignore status TASK_RUNNING because the the task is already running")
@@ -234,12 +362,8 @@ func (k *inMemoryTaskRegistry) recordFinishedTask(taskId string) *ring.Ring {
 func (k *inMemoryTaskRegistry) handleTaskFailed(task *PodTask, state StateType, status *mesos.TaskStatus) {
 	log.Errorf("task failed: %+v", status)
 	switch state {
-	case StatePending:
-		delete(k.taskRegistry, task.ID)
-		delete(k.podToTask, task.podKey)
-	case StateRunning:
-		delete(k.taskRegistry, task.ID)
-		delete(k.podToTask, task.podKey)
+	case StatePending, StateRunning:
+		k.deleteTask(task, status)
 	}
 }
 
@@ -255,8 +379,7 @@ func (k *inMemoryTaskRegistry) handleTaskKilled(task *PodTask, state StateType,
 	}()
 	switch state {
 	case StatePending, StateRunning:
-		delete(k.taskRegistry, task.ID)
-		delete(k.podToTask, task.podKey)
+		k.deleteTask(task, status)
 	}
 }
 
@@ -264,7 +387,115 @@ func (k *inMemoryTaskRegistry) handleTaskLost(task *PodTask, state StateType, st
 	log.Warningf("task lost: %+v", status)
 	switch state {
 	case StateRunning, StatePending:
-		delete(k.taskRegistry, task.ID)
-		delete(k.podToTask, task.podKey)
+		k.deleteTask(task, status)
+	}
+}
+
+// deleteTask drops task from the registry and its backing store, and emits
+// a user-facing event and retry decision classified from status's reason.
+// assumes the caller is holding k.rw.
+func (k *inMemoryTaskRegistry) deleteTask(task *PodTask, status *mesos.TaskStatus) {
+	delete(k.taskRegistry, task.ID)
+	delete(k.podToTask, task.podKey)
+	if err := k.store.Delete(task.ID); err != nil {
+		log.Errorf("failed to delete persisted task %v: %v", task.ID, err)
+	}
+	if k.backoff != nil {
+		k.backoff.Bump(task.podKey)
+	}
+	k.recordFailure(task, status)
+}
+
+// eventForReason translates a Mesos task status reason into the
+// user-facing Kubernetes event type and message reported on the pod.
+func eventForReason(status *mesos.TaskStatus) (reason, message string) {
+	switch status.GetReason() {
+	case mesos.TaskStatus_REASON_CONTAINER_LIMITATION_MEMORY:
+		return "OOMKilled", "the container was killed for exceeding its memory limit"
+	case mesos.TaskStatus_REASON_SLAVE_REMOVED:
+		return "NodeLost", "the Mesos slave running this pod was removed from the cluster"
+	case mesos.TaskStatus_REASON_EXECUTOR_TERMINATED:
+		return "ExecutorFailed", "the Mesos executor running this pod terminated unexpectedly"
+	case mesos.TaskStatus_REASON_EXECUTOR_UNREGISTERED:
+		return "ExecutorFailed", "the Mesos executor running this pod failed to (re-)register"
+	case mesos.TaskStatus_REASON_TASK_INVALID:
+		return "InvalidTask", "the Mesos master rejected this task as invalid"
+	default:
+		return "TaskFailed", "the task ended unexpectedly"
+	}
+}
+
+// RetryPolicy decides, for a given terminal TaskStatus, whether the pod
+// backing the task should be requeued for (re-)scheduling. Registered via
+// SetRetryPolicy; DefaultRetryPolicy is used when none is set.
+type RetryPolicy func(status *mesos.TaskStatus) bool
+
+// DefaultRetryPolicy requeues every failure except REASON_TASK_INVALID,
+// which indicates the master will never accept this task as-is and so
+// retrying is certain to fail again.
+func DefaultRetryPolicy(status *mesos.TaskStatus) bool {
+	return status.GetReason() != mesos.TaskStatus_REASON_TASK_INVALID
+}
+
+// recordFailure emits a structured event on task's pod describing why the
+// task ended, and records whether it's eligible for a retry. assumes the
+// caller is holding k.rw.
+func (k *inMemoryTaskRegistry) recordFailure(task *PodTask, status *mesos.TaskStatus) {
+	if task == nil {
+		return
+	}
+
+	reason, message := eventForReason(status)
+	if msg := status.GetMessage(); msg != "" {
+		message = message + ": " + msg
 	}
+	if k.recorder != nil {
+		k.recorder.Event(task.Pod, reason, message)
+	}
+
+	retryPolicy := k.retryPolicy
+	if retryPolicy == nil {
+		retryPolicy = DefaultRetryPolicy
+	}
+	if !retryPolicy(status) {
+		k.permanentFailures[task.podKey] = true
+		log.Warningf("pod %v (task %v) failed permanently (%v), it will not be requeued", task.podKey, task.ID, reason)
+	} else {
+		delete(k.permanentFailures, task.podKey)
+	}
+}
+
+// shouldRetry reports whether the pod identified by podKey is still
+// eligible to be requeued for scheduling, per the last RetryPolicy
+// decision recorded for it.
+func (k *inMemoryTaskRegistry) shouldRetry(podKey string) bool {
+	k.rw.RLock()
+	defer k.rw.RUnlock()
+	return !k.permanentFailures[podKey]
+}
+
+// SetEventRecorder wires an EventRecorder used to surface why a pod's task
+// ended (OOMKilled, NodeLost, ExecutorFailed, ...) as a Kubernetes event on
+// the pod, instead of only a flat log line.
+func (k *inMemoryTaskRegistry) SetEventRecorder(recorder record.EventRecorder) {
+	k.rw.Lock()
+	defer k.rw.Unlock()
+	k.recorder = recorder
+}
+
+// SetRetryPolicy overrides DefaultRetryPolicy for deciding whether a failed
+// task's pod should be requeued for scheduling.
+func (k *inMemoryTaskRegistry) SetRetryPolicy(policy RetryPolicy) {
+	k.rw.Lock()
+	defer k.rw.Unlock()
+	k.retryPolicy = policy
+}
+
+// SetBackoff wires a PodBackoff that's bumped whenever a task is dropped
+// from the registry due to failure, loss, or explicit unregistration, so
+// that a pod which can't be placed doesn't get retried in a tight loop.
+func (k *inMemoryTaskRegistry) SetBackoff(b *backoff.PodBackoff) {
+	k.rw.Lock()
+	defer k.rw.Unlock()
+	k.backoff = b
 }
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"sync"
+)
+
+// Store is the persistence abstraction backing a TaskRegistry. It knows
+// nothing about task state transitions -- just how to durably save, load,
+// list and delete the PodTask records a TaskRegistry hands it.
+type Store interface {
+	Save(task *PodTask) error
+	Load(taskID string) (*PodTask, error)
+	List() ([]*PodTask, error)
+	Delete(taskID string) error
+}
+
+// inMemoryStore is the default Store: it keeps tasks in a process-local map
+// and loses everything on restart. It's what the scheduler used exclusively
+// before persistent stores existed, and remains the default for tests and
+// for deployments that don't care about surviving a scheduler restart.
+type inMemoryStore struct {
+	rw    sync.RWMutex
+	tasks map[string]*PodTask
+}
+
+// NewInMemoryStore creates a Store that holds tasks only in memory.
+func NewInMemoryStore() Store {
+	return &inMemoryStore{
+		tasks: make(map[string]*PodTask),
+	}
+}
+
+func (s *inMemoryStore) Save(task *PodTask) error {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	s.tasks[task.ID] = task
+	return nil
+}
+
+func (s *inMemoryStore) Load(taskID string) (*PodTask, error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.tasks[taskID], nil
+}
+
+func (s *inMemoryStore) List() ([]*PodTask, error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	tasks := make([]*PodTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *inMemoryStore) Delete(taskID string) error {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	delete(s.tasks, taskID)
+	return nil
+}
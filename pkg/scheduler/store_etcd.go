@@ -0,0 +1,140 @@
+package scheduler
+
+import (
+	"encoding/json"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/registry/etcd"
+	goetcd "github.com/coreos/go-etcd/etcd"
+	log "github.com/golang/glog"
+)
+
+// TaskPath roots where task records live in etcd, mirroring PodPath's use
+// of makePodKey so that task and pod state are namespaced the same way.
+const TaskPath = "/kubernetes-mesos/tasks"
+
+// makeTaskKey constructs the etcd path under which a task's JSON is stored,
+// using the same namespacing discipline as makePodKey.
+func makeTaskKey(ctx api.Context, taskID string) (string, error) {
+	return etcd.MakeEtcdItemKey(ctx, TaskPath, taskID)
+}
+
+// etcdStore is a Store backed by etcd, allowing the scheduler's task
+// registry to survive a scheduler restart/failover within the Mesos
+// framework failover_timeout window.
+type etcdStore struct {
+	client *goetcd.Client
+}
+
+// NewEtcdStore creates an etcd-backed Store using client.
+func NewEtcdStore(client *goetcd.Client) Store {
+	return &etcdStore{client: client}
+}
+
+func (s *etcdStore) Save(task *PodTask) error {
+	ctx := api.WithNamespace(api.NewContext(), task.Pod.Namespace)
+	key, err := makeTaskKey(ctx, task.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Set(key, string(data), 0)
+	return err
+}
+
+func (s *etcdStore) Load(taskID string) (*PodTask, error) {
+	tasks, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		if task.ID == taskID {
+			return task, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *etcdStore) List() ([]*PodTask, error) {
+	resp, err := s.client.Get(TaskPath, false, true)
+	if err != nil {
+		if isEtcdNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	tasks := make([]*PodTask, 0)
+	walkEtcdNodes(resp.Node, func(n *goetcd.Node) {
+		task := &PodTask{}
+		if jerr := json.Unmarshal([]byte(n.Value), task); jerr != nil {
+			log.Errorf("failed to unmarshal task at %v: %v", n.Key, jerr)
+			return
+		}
+		if err := restorePodKey(task); err != nil {
+			log.Errorf("failed to restore pod key for task %v: %v", task.ID, err)
+			return
+		}
+		tasks = append(tasks, task)
+	})
+	return tasks, nil
+}
+
+// restorePodKey recomputes task.podKey from task.Pod. podKey is unexported
+// so encoding/json drops it on the Save/List round-trip through etcd; it
+// must be rebuilt from the pod's namespace and name via makePodKey (the key
+// inMemoryTaskRegistry.register files the task under in podToTask), or
+// every recovered task would collapse onto the zero-value "" entry in
+// podToTask.
+func restorePodKey(task *PodTask) error {
+	ctx := api.WithNamespace(api.NewContext(), task.Pod.Namespace)
+	key, err := makePodKey(ctx, task.Pod.Name)
+	if err != nil {
+		return err
+	}
+	task.podKey = key
+	return nil
+}
+
+func (s *etcdStore) Delete(taskID string) error {
+	tasks, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if task.ID != taskID {
+			continue
+		}
+		ctx := api.WithNamespace(api.NewContext(), task.Pod.Namespace)
+		key, err := makeTaskKey(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		_, err = s.client.Delete(key, false)
+		return err
+	}
+	return nil
+}
+
+func walkEtcdNodes(n *goetcd.Node, visit func(*goetcd.Node)) {
+	if n == nil {
+		return
+	}
+	if !n.Dir {
+		visit(n)
+		return
+	}
+	for _, child := range n.Nodes {
+		walkEtcdNodes(child, visit)
+	}
+}
+
+func isEtcdNotFound(err error) bool {
+	if etcdErr, ok := err.(*goetcd.EtcdError); ok {
+		return etcdErr.ErrorCode == 100 // EcodeKeyNotFound
+	}
+	return false
+}